@@ -1,18 +1,33 @@
 package csvtools
 
 import (
+	"bytes"
 	"encoding/json"
+	"fmt"
 	"io"
 	"io/ioutil"
+	"regexp"
+	"sort"
+	"strconv"
 	"strings"
 
 	yaml "github.com/ghodss/yaml"
 	csvv1 "github.com/operator-framework/api/pkg/operators/v1alpha1"
+	yamlv2 "gopkg.in/yaml.v2"
 	appsv1 "k8s.io/api/apps/v1"
 	rbacv1 "k8s.io/api/rbac/v1"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 )
 
+const (
+	defaultIndent = 2
+	maxIndent     = 9
+)
+
+// blockScalarHeader matches the end of a line starting a literal or folded block scalar,
+// capturing the optional explicit indentation indicator
+var blockScalarHeader = regexp.MustCompile(`(^|: )[|>](?:([1-9])[-+]?|[-+]([1-9])?)?$`)
+
 // CSVClusterPermissions is the cluster permissions part of a CSV
 type CSVClusterPermissions struct {
 	ServiceAccountName string              `json:"serviceAccountName"`
@@ -54,12 +69,36 @@ func UnmarshalCSV(filePath string) *csvv1.ClusterServiceVersion {
 	return csvStruct
 }
 
+// MarshallOptions tunes the YAML produced by MarshallObjectWithOptions
+type MarshallOptions struct {
+	// OmitEmpty drops null values and empty slices from the output, maps are kept even when empty
+	OmitEmpty bool
+	// Indent is the number of spaces used per nested mapping level, between 2 and 9, defaults to 2.
+	// Only the indentation changes: sequences stay flush with their parent key, and the lines of
+	// block scalars keep their content, indented by Indent below their key.
+	Indent int
+	// KeepFieldOrder emits the fields of structs, like metadata, in their declaration order instead of
+	// sorting all keys alphabetically. Keys of Go maps, like labels and annotations, are always sorted.
+	KeepFieldOrder bool
+}
+
 // MarshallObject mashals an object, usually a CSV into YAML
 func MarshallObject(obj interface{}, writer io.Writer) error {
+	return MarshallObjectWithOptions(obj, writer, MarshallOptions{})
+}
+
+// MarshallObjectWithOptions mashals an object into YAML, formatted according to the given options
+func MarshallObjectWithOptions(obj interface{}, writer io.Writer, opts MarshallOptions) error {
+	if opts.Indent != 0 && (opts.Indent < defaultIndent || opts.Indent > maxIndent) {
+		return fmt.Errorf("indent should be between %d and %d, got %d", defaultIndent, maxIndent, opts.Indent)
+	}
+
 	jsonBytes, err := json.Marshal(obj)
 	if err != nil {
 		return err
 	}
+	// the JSON encoding of structs follows the fields declaration order
+	fieldOrderJSON := jsonBytes
 
 	var r unstructured.Unstructured
 	if err := json.Unmarshal(jsonBytes, &r.Object); err != nil {
@@ -83,16 +122,29 @@ func MarshallObject(obj interface{}, writer io.Writer) error {
 		unstructured.SetNestedSlice(r.Object, deployments, "spec", "install", "spec", "deployments")
 	}
 
+	if opts.OmitEmpty {
+		pruneEmptyFields(r.Object)
+	}
+
 	jsonBytes, err = json.Marshal(r.Object)
 	if err != nil {
 		return err
 	}
 
-	yamlBytes, err := yaml.JSONToYAML(jsonBytes)
+	var yamlBytes []byte
+	if opts.KeepFieldOrder {
+		yamlBytes, err = jsonToOrderedYAML(jsonBytes, fieldOrderJSON)
+	} else {
+		yamlBytes, err = yaml.JSONToYAML(jsonBytes)
+	}
 	if err != nil {
 		return err
 	}
 
+	if opts.Indent != 0 && opts.Indent != defaultIndent {
+		yamlBytes = reindent(yamlBytes, opts.Indent)
+	}
+
 	// fix double quoted strings by removing unneeded single quotes...
 	s := string(yamlBytes)
 	s = strings.Replace(s, " '\"", " \"", -1)
@@ -112,3 +164,167 @@ func MarshallObject(obj interface{}, writer io.Writer) error {
 
 	return nil
 }
+
+// jsonToOrderedYAML converts JSON to YAML like yaml.JSONToYAML, but orders the keys of every
+// mapping like the keys of the matching mapping in the template JSON
+func jsonToOrderedYAML(jsonBytes []byte, templateJSON []byte) ([]byte, error) {
+	// JSON is a subset of YAML, decoding it this way keeps integers as integers
+	var obj interface{}
+	if err := yamlv2.Unmarshal(jsonBytes, &obj); err != nil {
+		return nil, err
+	}
+
+	// nested mappings of a MapSlice are decoded as MapSlices as well, keeping their order
+	var template yamlv2.MapSlice
+	if err := yamlv2.Unmarshal(templateJSON, &template); err != nil {
+		return nil, err
+	}
+
+	return yamlv2.Marshal(orderLike(obj, template))
+}
+
+// orderLike returns the value with the keys of its mappings ordered like in the template,
+// keys missing from the template come last, sorted
+func orderLike(value interface{}, template interface{}) interface{} {
+	switch v := value.(type) {
+	case map[interface{}]interface{}:
+		templateMapping, _ := template.(yamlv2.MapSlice)
+		ordered := make(yamlv2.MapSlice, 0, len(v))
+		for _, item := range templateMapping {
+			if child, ok := v[item.Key]; ok {
+				ordered = append(ordered, yamlv2.MapItem{Key: item.Key, Value: orderLike(child, item.Value)})
+				delete(v, item.Key)
+			}
+		}
+
+		var rest []string
+		for key := range v {
+			// keys decoded from JSON are always strings
+			rest = append(rest, key.(string))
+		}
+		sort.Strings(rest)
+		for _, key := range rest {
+			ordered = append(ordered, yamlv2.MapItem{Key: key, Value: orderLike(v[key], nil)})
+		}
+		return ordered
+	case []interface{}:
+		templateSequence, _ := template.([]interface{})
+		for i := range v {
+			var itemTemplate interface{}
+			if i < len(templateSequence) {
+				itemTemplate = templateSequence[i]
+			}
+			v[i] = orderLike(v[i], itemTemplate)
+		}
+		return v
+	}
+	return value
+}
+
+// reindent changes the indentation of YAML emitted with the default indentation of 2 spaces.
+// Every nested mapping is indented by the given number of spaces, sequence items stay flush with
+// their parent key. The content of a "- " sequence item, of a "? " explicit key and of its ": " value,
+// which yaml.v2 uses for keys longer than 128 characters, stays 2 columns after the indicator.
+// Block scalar lines are indented by the given number of spaces below their key or indicator, or by
+// the explicit indentation indicator of the block header when there is one.
+func reindent(yamlBytes []byte, indent int) []byte {
+	type level struct {
+		oldColumn int
+		newColumn int
+	}
+	levels := []level{{}}
+
+	var b bytes.Buffer
+	inBlock := false
+	var blockParentOld, blockOld, blockNew int
+	for _, line := range strings.SplitAfter(string(yamlBytes), "\n") {
+		content := strings.TrimLeft(line, " ")
+		column := len(line) - len(content)
+		blank := strings.TrimSpace(content) == ""
+
+		if inBlock {
+			if blockOld == 0 && !blank && column > blockParentOld {
+				blockOld = column
+			}
+			if blockOld != 0 && column >= blockOld {
+				b.WriteString(strings.Repeat(" ", blockNew) + line[blockOld:])
+				continue
+			}
+			if blank {
+				b.WriteString(line)
+				continue
+			}
+			inBlock = false
+		}
+
+		if blank {
+			b.WriteString(line)
+			continue
+		}
+
+		for len(levels) > 1 && levels[len(levels)-1].oldColumn > column {
+			levels = levels[:len(levels)-1]
+		}
+		current := levels[len(levels)-1]
+		if column > current.oldColumn {
+			// a mapping nested under the key of the previous line
+			current = level{oldColumn: column, newColumn: current.newColumn + indent}
+			levels = append(levels, current)
+		}
+		b.WriteString(strings.Repeat(" ", current.newColumn) + content)
+
+		// every sequence item, explicit key or explicit value indicator opens a level for its content
+		rest := strings.TrimRight(content, "\n")
+		for strings.HasPrefix(rest, "- ") || strings.HasPrefix(rest, "? ") || strings.HasPrefix(rest, ": ") {
+			rest = rest[2:]
+			current = level{oldColumn: current.oldColumn + 2, newColumn: current.newColumn + 2}
+			levels = append(levels, current)
+		}
+
+		header := blockScalarHeader.FindStringSubmatch(rest)
+		if header == nil {
+			continue
+		}
+		parent := current
+		if header[1] == "" {
+			// the block scalar is the node after the indicator itself, its parent is the indicator
+			parent = level{oldColumn: current.oldColumn - 2, newColumn: current.newColumn - 2}
+		}
+		inBlock = true
+		blockParentOld = parent.oldColumn
+		blockOld, blockNew = 0, parent.newColumn+indent
+		if indicator := header[2] + header[3]; indicator != "" {
+			offset, _ := strconv.Atoi(indicator)
+			blockOld, blockNew = parent.oldColumn+offset, parent.newColumn+offset
+		}
+	}
+
+	return b.Bytes()
+}
+
+// pruneEmptyFields recursively removes null values and empty slices from the given map, including maps
+// nested in slices at any depth. Maps are always kept, even when empty, since an empty map can carry
+// meaning, like an "emptyDir: {}" volume source. Slice items are never removed, so list lengths are preserved.
+func pruneEmptyFields(obj map[string]interface{}) {
+	for key, value := range obj {
+		if isEmptyValue(value) {
+			delete(obj, key)
+		}
+	}
+}
+
+func isEmptyValue(value interface{}) bool {
+	switch v := value.(type) {
+	case nil:
+		return true
+	case map[string]interface{}:
+		pruneEmptyFields(v)
+	case []interface{}:
+		// only prune inside the items, an item that ends up empty is kept
+		for _, item := range v {
+			isEmptyValue(item)
+		}
+		return len(v) == 0
+	}
+	return false
+}
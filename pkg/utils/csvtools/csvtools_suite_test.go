@@ -0,0 +1,13 @@
+package csvtools
+
+import (
+	"testing"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+func TestCSVTools(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "CSV Tools Suite")
+}
@@ -0,0 +1,284 @@
+package csvtools
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	yaml "github.com/ghodss/yaml"
+	csvv1 "github.com/operator-framework/api/pkg/operators/v1alpha1"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+var update = flag.Bool("update", false, "update the golden files under testdata")
+
+// expectGolden compares the output with the content of the given golden file
+func expectGolden(output string, goldenFile string) {
+	goldenPath := filepath.Join("testdata", goldenFile)
+	if *update {
+		Expect(ioutil.WriteFile(goldenPath, []byte(output), 0644)).To(Succeed())
+	}
+
+	expected, err := ioutil.ReadFile(goldenPath)
+	Expect(err).ToNot(HaveOccurred())
+	Expect(output).To(Equal(string(expected)))
+}
+
+type testSpec struct {
+	Name    string            `json:"name"`
+	Args    []string          `json:"args"`
+	Labels  map[string]string `json:"labels"`
+	Pointer *string           `json:"pointer"`
+	Count   int               `json:"count"`
+	Enabled bool              `json:"enabled"`
+	Nested  *testSpec         `json:"nested,omitempty"`
+	Items   []testSpec        `json:"items"`
+}
+
+type testStatus struct {
+	Conditions map[string][]string `json:"conditions"`
+}
+
+type testObject struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec  testSpec   `json:"spec"`
+	Extra testStatus `json:"extra"`
+}
+
+func newTestObject() *testObject {
+	return &testObject{
+		TypeMeta: metav1.TypeMeta{
+			APIVersion: "test.openshift.io/v1",
+			Kind:       "Test",
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name: "test",
+		},
+		Spec: testSpec{
+			Name:   "spec",
+			Args:   []string{},
+			Nested: &testSpec{},
+			Items:  []testSpec{{Name: "item"}},
+		},
+	}
+}
+
+// longKey returns a label-like key longer than 128 characters, ending with the given suffix
+func longKey(suffix string) string {
+	return "example.openshift.io/" + strings.Repeat("long-key-", 15) + suffix
+}
+
+// newRoundTripObject returns an object with values that are easy to break while formatting YAML
+func newRoundTripObject() map[string]interface{} {
+	return map[string]interface{}{
+		"metadata": map[string]interface{}{
+			"annotations": map[string]interface{}{"a": "on", "b": "yes", "c": "n", "d": "off", "e": "true"},
+		},
+		"spec": map[string]interface{}{
+			"description": strings.Repeat("a long description ", 10),
+			"script":      "#!/bin/bash\n\nset -e\n  indented line\necho done\n",
+			"leading":     "  starts with spaces\nsecond line",
+			// keys longer than 128 characters are written as explicit "? key" and ": value" entries
+			"longKeys": map[string]interface{}{
+				longKey("scalar"):       "on",
+				longKey("mapping"):      map[string]interface{}{"a": "1", "b": map[string]interface{}{"c": "2"}},
+				longKey("sequence"):     []interface{}{"a", "b"},
+				longKey("block"):        "multi\nline",
+				longKey("multi\nline"):  "value",
+				longKey("nested/items"): []interface{}{map[string]interface{}{longKey("item"): []interface{}{map[string]interface{}{"x": "1", "y": "z\nw"}}}},
+			},
+			"items": []interface{}{
+				"first\nsecond",
+				"  leading\nspaces",
+				[]interface{}{"nested\nscalar", map[string]interface{}{"key": "multi\nline", "count": 3}},
+				map[string]interface{}{
+					"name": "item",
+					"env":  []interface{}{map[string]interface{}{"name": "A", "value": "no"}},
+				},
+			},
+		},
+	}
+}
+
+// expectRoundTrip unmarshals the YAML back and compares it with the original object
+func expectRoundTrip(output string, obj interface{}) {
+	jsonBytes, err := json.Marshal(obj)
+	Expect(err).ToNot(HaveOccurred())
+	var expected map[string]interface{}
+	Expect(json.Unmarshal(jsonBytes, &expected)).To(Succeed())
+
+	var actual map[string]interface{}
+	Expect(yaml.Unmarshal([]byte(output), &actual)).To(Succeed())
+	Expect(actual).To(Equal(expected))
+}
+
+var _ = Describe("CSV tools", func() {
+	Context("Marshall object", func() {
+		It("should keep empty fields by default", func() {
+			var b bytes.Buffer
+			Expect(MarshallObject(newTestObject(), &b)).To(Succeed())
+			expectGolden(b.String(), "default.yaml")
+		})
+
+		It("should omit null values and empty slices when requested", func() {
+			var b bytes.Buffer
+			Expect(MarshallObjectWithOptions(newTestObject(), &b, MarshallOptions{OmitEmpty: true})).To(Succeed())
+			expectGolden(b.String(), "omit-empty.yaml")
+		})
+
+		It("should keep maps that are empty or only contain empty fields", func() {
+			obj := newTestObject()
+			obj.Extra.Conditions = map[string][]string{"ready": {}}
+
+			var b bytes.Buffer
+			Expect(MarshallObjectWithOptions(obj, &b, MarshallOptions{OmitEmpty: true})).To(Succeed())
+			Expect(b.String()).To(ContainSubstring("\nextra:\n  conditions: {}\n"))
+		})
+
+		It("should keep empty dir volumes of the CSV deployments", func() {
+			csv := &csvv1.ClusterServiceVersion{
+				Spec: csvv1.ClusterServiceVersionSpec{
+					InstallStrategy: csvv1.NamedInstallStrategy{
+						StrategyName: "deployment",
+						StrategySpec: csvv1.StrategyDetailsDeployment{
+							DeploymentSpecs: []csvv1.StrategyDeploymentSpec{
+								{
+									Name: "performance-operator",
+									Spec: appsv1.DeploymentSpec{
+										Template: corev1.PodTemplateSpec{
+											Spec: corev1.PodSpec{
+												Volumes: []corev1.Volume{
+													{
+														Name: "cache",
+														VolumeSource: corev1.VolumeSource{
+															EmptyDir: &corev1.EmptyDirVolumeSource{},
+														},
+													},
+												},
+											},
+										},
+									},
+								},
+							},
+						},
+					},
+				},
+			}
+
+			var b bytes.Buffer
+			Expect(MarshallObjectWithOptions(csv, &b, MarshallOptions{OmitEmpty: true})).To(Succeed())
+			Expect(b.String()).To(ContainSubstring("emptyDir: {}"))
+
+			parsed := &csvv1.ClusterServiceVersion{}
+			Expect(yaml.Unmarshal(b.Bytes(), parsed)).To(Succeed())
+			volumes := parsed.Spec.InstallStrategy.StrategySpec.DeploymentSpecs[0].Spec.Template.Spec.Volumes
+			Expect(volumes).To(HaveLen(1))
+			Expect(volumes[0].EmptyDir).ToNot(BeNil())
+		})
+
+		It("should prune maps nested in slices at any depth", func() {
+			obj := map[string]interface{}{
+				"kind": "Test",
+				"nested": []interface{}{
+					[]interface{}{
+						map[string]interface{}{"value": nil, "name": "keep"},
+						map[string]interface{}{"value": nil},
+					},
+				},
+			}
+
+			var b bytes.Buffer
+			Expect(MarshallObjectWithOptions(obj, &b, MarshallOptions{OmitEmpty: true})).To(Succeed())
+			expectGolden(b.String(), "omit-empty-nested.yaml")
+		})
+
+		It("should use the requested indentation", func() {
+			obj := newTestObject()
+			obj.Labels = map[string]string{"b": "second", "a": "first"}
+
+			var b bytes.Buffer
+			Expect(MarshallObjectWithOptions(obj, &b, MarshallOptions{OmitEmpty: true, Indent: 4})).To(Succeed())
+			expectGolden(b.String(), "indent-4.yaml")
+		})
+
+		It("should keep the default format for an indentation of 2", func() {
+			var b bytes.Buffer
+			Expect(MarshallObjectWithOptions(newTestObject(), &b, MarshallOptions{Indent: 2})).To(Succeed())
+			expectGolden(b.String(), "default.yaml")
+		})
+
+		It("should only change the indentation", func() {
+			var defaultOutput bytes.Buffer
+			Expect(MarshallObject(newRoundTripObject(), &defaultOutput)).To(Succeed())
+
+			for indent := 3; indent <= 9; indent++ {
+				var b bytes.Buffer
+				Expect(MarshallObjectWithOptions(newRoundTripObject(), &b, MarshallOptions{Indent: indent})).To(Succeed())
+				Expect(strings.Count(b.String(), "\n")).To(Equal(strings.Count(defaultOutput.String(), "\n")))
+				Expect(strings.Fields(b.String())).To(Equal(strings.Fields(defaultOutput.String())))
+			}
+		})
+
+		It("should keep the values when changing the indentation", func() {
+			for indent := 2; indent <= 9; indent++ {
+				for _, keepFieldOrder := range []bool{false, true} {
+					var b bytes.Buffer
+					opts := MarshallOptions{Indent: indent, KeepFieldOrder: keepFieldOrder}
+					Expect(MarshallObjectWithOptions(newRoundTripObject(), &b, opts)).To(Succeed())
+					expectRoundTrip(b.String(), newRoundTripObject())
+				}
+			}
+		})
+
+		It("should quote YAML 1.1 boolean-like strings with any indentation", func() {
+			var b bytes.Buffer
+			Expect(MarshallObjectWithOptions(newRoundTripObject(), &b, MarshallOptions{Indent: 4})).To(Succeed())
+			Expect(b.String()).To(MatchRegexp(`        a: "on"\n        b: "yes"\n        c: "n"\n        d: "off"\n`))
+		})
+
+		It("should sort all keys by default", func() {
+			obj := newTestObject()
+			obj.Annotations = map[string]string{"z": "1", "m": "2", "a": "3"}
+
+			for _, indent := range []int{0, 3} {
+				var b bytes.Buffer
+				Expect(MarshallObjectWithOptions(obj, &b, MarshallOptions{Indent: indent})).To(Succeed())
+				Expect(b.String()).To(MatchRegexp(`^---\napiVersion: .*\nextra:\n`))
+				Expect(b.String()).To(MatchRegexp(`annotations:\n\s+a: "3"\n\s+m: "2"\n\s+z: "1"\n`))
+			}
+		})
+
+		It("should keep the struct fields order when requested", func() {
+			obj := newTestObject()
+			obj.Annotations = map[string]string{"z": "1", "m": "2", "a": "3"}
+
+			var b bytes.Buffer
+			Expect(MarshallObjectWithOptions(obj, &b, MarshallOptions{KeepFieldOrder: true})).To(Succeed())
+			expectGolden(b.String(), "field-order.yaml")
+
+			var sorted bytes.Buffer
+			Expect(MarshallObject(obj, &sorted)).To(Succeed())
+			var expected, actual map[string]interface{}
+			Expect(yaml.Unmarshal(sorted.Bytes(), &expected)).To(Succeed())
+			Expect(yaml.Unmarshal(b.Bytes(), &actual)).To(Succeed())
+			Expect(actual).To(Equal(expected))
+		})
+
+		It("should reject an invalid indentation", func() {
+			for _, indent := range []int{-1, 1, 10} {
+				var b bytes.Buffer
+				Expect(MarshallObjectWithOptions(newTestObject(), &b, MarshallOptions{Indent: indent})).ToNot(Succeed())
+			}
+		})
+	})
+})
@@ -37,6 +37,8 @@ var (
 	maintainersFile = flag.String("maintainers-from", "", "add maintainers list from given file")
 	descriptionFile = flag.String("description-from", "", "replace the description with the content of the given file")
 
+	omitEmpty = flag.Bool("omit-empty", false, "omit null values and empty slices from the generated CSV")
+
 	semverVersion *semver.Version
 )
 
@@ -193,7 +195,7 @@ Performance Addon Operator provides the ability to enable advanced node performa
 
 	// write CSV to out dir
 	writer := strings.Builder{}
-	csvtools.MarshallObject(operatorCSV, &writer)
+	csvtools.MarshallObjectWithOptions(operatorCSV, &writer, csvtools.MarshallOptions{OmitEmpty: *omitEmpty})
 	outputFilename := filepath.Join(*outputDir, finalizedCsvFilename())
 	err := ioutil.WriteFile(outputFilename, []byte(writer.String()), 0644)
 	if err != nil {
@@ -13,9 +13,10 @@ import (
 var (
 	csvInput      = flag.String("csv-input", "", "path to csv to update")
 	operatorImage = flag.String("operator-image", "", "operator container image")
+	omitEmpty     = flag.Bool("omit-empty", false, "omit null values and empty slices from the updated csv")
 )
 
-func processCSV(operatorImage, csvInput string, dst io.Writer) {
+func processCSV(operatorImage, csvInput string, omitEmpty bool, dst io.Writer) {
 	operatorCSV := csvtools.UnmarshalCSV(csvInput)
 
 	strategySpec := operatorCSV.Spec.InstallStrategy.StrategySpec
@@ -29,7 +30,7 @@ func processCSV(operatorImage, csvInput string, dst io.Writer) {
 
 	operatorCSV.Annotations["containerImage"] = operatorImage
 
-	csvtools.MarshallObject(operatorCSV, dst)
+	csvtools.MarshallObjectWithOptions(operatorCSV, dst, csvtools.MarshallOptions{OmitEmpty: omitEmpty})
 }
 
 func main() {
@@ -41,5 +42,5 @@ func main() {
 		log.Fatal("--operator-image is required")
 	}
 
-	processCSV(*operatorImage, *csvInput, os.Stdout)
+	processCSV(*operatorImage, *csvInput, *omitEmpty, os.Stdout)
 }